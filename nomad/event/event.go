@@ -0,0 +1,165 @@
+// Package event holds the subscribe logic shared by Nomad's two
+// event-stream transports: the internal streaming RPC (Event.Stream,
+// implemented in nomad/event_endpoint.go) and the gRPC endpoint
+// (EventService.Subscribe, implemented in nomad/event_grpc_endpoint.go).
+// Keeping ACL enforcement and subscription handling in one place means the
+// two transports can't drift apart on who is allowed to see what.
+package event
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/nomad/acl"
+	"github.com/hashicorp/nomad/helper/uuid"
+	"github.com/hashicorp/nomad/nomad/stream"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// Server is the subset of *nomad.Server the subscribe path needs. It exists
+// to avoid an import cycle: this package can't import package nomad, so
+// each transport adapts its own *nomad.Server to satisfy this interface.
+type Server interface {
+	ResolveToken(secretID string) (*acl.ACL, error)
+	EventBroker() (*stream.EventBroker, error)
+}
+
+// Sink receives batches of events read from a subscription by Subscribe.
+// The gRPC handler's sink sends them as individual Event messages on the
+// response stream; Event.stream does not use a Sink and writes its own
+// msgpack frames.
+type Sink interface {
+	Send(structs.Events) error
+}
+
+// Authorize resolves the ACL token on args, builds the SubscribeRequest the
+// EventBroker expects (including the Subjects routing hint derived from
+// args.Topics), and verifies the token is allowed to read every requested
+// topic. Both Event.stream and EventService.Subscribe call this so a topic
+// that's off-limits over one transport is off-limits over the other.
+func Authorize(srv Server, args structs.EventStreamRequest) (*stream.SubscribeRequest, error) {
+	aclObj, err := srv.ResolveToken(args.AuthToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// authToken is what the subscription is tracked under, so the broker
+	// can force-close it if the token is later updated or deleted. If ACLs
+	// are disabled a random token is used instead and will never be closed
+	// due to expiry.
+	authToken := args.AuthToken
+	if authToken == "" {
+		authToken = uuid.Generate()
+	}
+
+	subjects, wildcard := stream.SubjectsFromTopics(args.Topics)
+	if wildcard {
+		subjects = nil
+	}
+
+	subReq := &stream.SubscribeRequest{
+		Token:     authToken,
+		Topics:    args.Topics,
+		Subjects:  subjects,
+		Filter:    args.Filter,
+		Index:     uint64(args.Index),
+		Namespace: args.Namespace,
+	}
+
+	if aclObj != nil {
+		if err := aclCheckForEvents(subReq, aclObj); err != nil {
+			return nil, structs.ErrPermissionDenied
+		}
+	}
+
+	return subReq, nil
+}
+
+// OpenSubscription opens a subscription against srv's EventBroker for an
+// already-authorized subReq.
+func OpenSubscription(srv Server, subReq *stream.SubscribeRequest) (*stream.Subscription, error) {
+	publisher, err := srv.EventBroker()
+	if err != nil {
+		return nil, err
+	}
+	return publisher.Subscribe(subReq)
+}
+
+// Subscribe is the simple form of the subscribe path: authorize, open a
+// subscription, and pump events to sink until ctx is done or the
+// subscription ends. Event.stream uses Authorize and OpenSubscription
+// directly instead, since it also has to recover from a force-closed
+// subscription (ACL change, graceful shutdown) rather than just giving up.
+func Subscribe(ctx context.Context, srv Server, args structs.EventStreamRequest, sink Sink) error {
+	subReq, err := Authorize(srv, args)
+	if err != nil {
+		return err
+	}
+
+	subscription, err := OpenSubscription(srv, subReq)
+	if err != nil {
+		return err
+	}
+	defer subscription.Unsubscribe()
+
+	for {
+		events, err := subscription.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(events.Events) == 0 {
+			continue
+		}
+
+		if err := sink.Send(events); err != nil {
+			return err
+		}
+	}
+}
+
+// aclCheckForEvents verifies that aclObj is permitted to read every topic
+// requested in subReq.
+func aclCheckForEvents(subReq *stream.SubscribeRequest, aclObj *acl.ACL) error {
+	if len(subReq.Topics) == 0 {
+		return fmt.Errorf("invalid topic request")
+	}
+
+	reqPolicies := make(map[string]struct{})
+	var required = struct{}{}
+
+	for topic := range subReq.Topics {
+		switch {
+		case topic == structs.TopicAll:
+			reqPolicies["management"] = required
+		case topic == structs.TopicNode:
+			reqPolicies["node-read"] = required
+		case stream.NamespacedTopics[topic]:
+			// Shared with nomad/stream.Subscription.matchesRequest so the
+			// ACL check and the broker's namespace filtering can't drift
+			// apart on which topics are namespace-scoped.
+			reqPolicies[acl.NamespaceCapabilityReadJob] = required
+		default:
+			return fmt.Errorf("unknown topic %s", topic)
+		}
+	}
+
+	for checks := range reqPolicies {
+		switch checks {
+		case acl.NamespaceCapabilityReadJob:
+			if ok := aclObj.AllowNsOp(subReq.Namespace, acl.NamespaceCapabilityReadJob); !ok {
+				return structs.ErrPermissionDenied
+			}
+		case "node-read":
+			if ok := aclObj.AllowNodeRead(); !ok {
+				return structs.ErrPermissionDenied
+			}
+		case "management":
+			if ok := aclObj.IsManagement(); !ok {
+				return structs.ErrPermissionDenied
+			}
+		}
+	}
+
+	return nil
+}
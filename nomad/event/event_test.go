@@ -0,0 +1,41 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/acl"
+	"github.com/hashicorp/nomad/nomad/stream"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer is a minimal event.Server used to test Authorize without a
+// real *nomad.Server.
+type fakeServer struct {
+	acl    *acl.ACL
+	broker *stream.EventBroker
+}
+
+func (f *fakeServer) ResolveToken(string) (*acl.ACL, error) { return f.acl, nil }
+func (f *fakeServer) EventBroker() (*stream.EventBroker, error) {
+	return f.broker, nil
+}
+
+func TestAuthorize_UnknownTopic(t *testing.T) {
+	srv := &fakeServer{acl: acl.ManagementACL, broker: stream.NewEventBroker()}
+
+	_, err := Authorize(srv, structs.EventStreamRequest{
+		Topics: map[structs.Topic][]string{"not-a-real-topic": {}},
+	})
+	require.Error(t, err)
+}
+
+func TestAuthorize_PopulatesSubjects(t *testing.T) {
+	srv := &fakeServer{acl: acl.ManagementACL, broker: stream.NewEventBroker()}
+
+	subReq, err := Authorize(srv, structs.EventStreamRequest{
+		Topics: map[structs.Topic][]string{structs.TopicJob: {"web"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []stream.Subject{{Topic: structs.TopicJob, Key: "web"}}, subReq.Subjects)
+}
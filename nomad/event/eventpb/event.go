@@ -0,0 +1,141 @@
+// Package eventpb implements the gRPC bindings described by event.proto.
+// This tree has no protoc/protoc-gen-go-grpc toolchain available, so the
+// types and service plumbing below are written by hand in the same shape
+// protoc-gen-go-grpc would emit; regenerate from event.proto with the
+// normal toolchain once one is available rather than hand-editing the
+// service boilerplate.
+//
+// Because these types are plain structs rather than protoc-gen-go output,
+// they don't implement proto.Message (no ProtoReflect), so they can't go
+// through gRPC's default "proto" codec. Instead this package registers its
+// own codec (see codec.go) and every Subscribe call is made with that
+// codec's content-subtype, so gRPC picks it instead of "proto" on both
+// ends without any extra server-side wiring.
+package eventpb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// SubscribeRequest is the gRPC request for EventService.Subscribe. It
+// mirrors structs.EventStreamRequest; the ACL token travels separately as
+// gRPC metadata rather than as a field here.
+type SubscribeRequest struct {
+	Topics    map[string]*TopicFilter
+	Namespace string
+	Index     int64
+	Region    string
+	Filter    string
+}
+
+// TopicFilter is the set of keys a caller wants for one topic; an empty
+// Keys means every key on that topic.
+type TopicFilter struct {
+	Keys []string
+}
+
+// Event is the gRPC wire form of structs.Event. Payload carries the same
+// JSON encoding Event.Stream already produces.
+type Event struct {
+	Topic     string
+	Type      string
+	Key       string
+	Namespace string
+	Index     uint64
+	Payload   []byte
+}
+
+// EventServiceServer is implemented by the Nomad server-side handler,
+// EventGRPCServer in nomad/event_grpc_endpoint.go.
+type EventServiceServer interface {
+	Subscribe(*SubscribeRequest, EventService_SubscribeServer) error
+}
+
+// EventService_SubscribeServer is the server-streaming handle passed to
+// EventServiceServer.Subscribe; one Send call per Event.
+type EventService_SubscribeServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+// EventServiceServiceDesc describes EventService for registration on a
+// grpc.Server against an EventServiceServer. This package does not register
+// it anywhere; EventService.Subscribe is reachable only on a server that
+// does.
+var EventServiceServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hashicorp.nomad.event.EventService",
+	HandlerType: (*EventServiceServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       eventServiceSubscribeHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+func eventServiceSubscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(SubscribeRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(EventServiceServer).Subscribe(req, &eventServiceSubscribeServer{stream})
+}
+
+type eventServiceSubscribeServer struct{ grpc.ServerStream }
+
+func (s *eventServiceSubscribeServer) Send(e *Event) error {
+	return s.ServerStream.SendMsg(e)
+}
+
+// EventServiceClient lets a caller open a Subscribe stream against a
+// remote Nomad server, used by EventGRPCServer to forward a subscription
+// to the region that actually owns it.
+type EventServiceClient interface {
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (EventService_SubscribeClient, error)
+}
+
+// EventService_SubscribeClient is the client side of the Subscribe stream.
+type EventService_SubscribeClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type eventServiceClient struct{ cc *grpc.ClientConn }
+
+// NewEventServiceClient wraps an existing gRPC connection to a Nomad
+// server with the EventService client.
+func NewEventServiceClient(cc *grpc.ClientConn) EventServiceClient {
+	return &eventServiceClient{cc: cc}
+}
+
+func (c *eventServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (EventService_SubscribeClient, error) {
+	// Force the content-subtype this package's codec registers under so
+	// gRPC marshals with it instead of the default "proto" codec, which
+	// these hand-written types don't implement; see the package doc.
+	opts = append(opts, grpc.CallContentSubtype(codecName))
+	stream, err := c.cc.NewStream(ctx, &EventServiceServiceDesc.Streams[0], "/hashicorp.nomad.event.EventService/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventServiceSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type eventServiceSubscribeClient struct{ grpc.ClientStream }
+
+func (x *eventServiceSubscribeClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -2,14 +2,16 @@ package nomad
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/go-msgpack/codec"
 	"github.com/hashicorp/nomad/acl"
 	"github.com/hashicorp/nomad/helper"
-	"github.com/hashicorp/nomad/helper/uuid"
+	"github.com/hashicorp/nomad/nomad/event"
 	"github.com/hashicorp/nomad/nomad/stream"
 	"github.com/hashicorp/nomad/nomad/structs"
 )
@@ -18,6 +20,20 @@ type Event struct {
 	srv *Server
 }
 
+// serverAdapter satisfies the event.Server interface the shared nomad/event
+// package expects, so both Event.stream here and EventGRPCServer.Subscribe
+// in event_grpc_endpoint.go can drive the same Authorize/OpenSubscription
+// logic from their own *Server.
+type serverAdapter struct{ srv *Server }
+
+func (a serverAdapter) ResolveToken(secretID string) (*acl.ACL, error) {
+	return a.srv.ResolveToken(secretID)
+}
+
+func (a serverAdapter) EventBroker() (*stream.EventBroker, error) {
+	return a.srv.State().EventBroker()
+}
+
 func (e *Event) register() {
 	e.srv.streamingRpcs.Register("Event.Stream", e.stream)
 }
@@ -43,39 +59,16 @@ func (e *Event) stream(conn io.ReadWriteCloser) {
 		return
 	}
 
-	aclObj, err := e.srv.ResolveToken(args.AuthToken)
+	// Authorize builds the SubscribeRequest and checks it against the
+	// token's ACL; it's the same path EventGRPCServer.Subscribe uses so the
+	// two transports enforce identical access control.
+	subReq, err := event.Authorize(serverAdapter{e.srv}, args)
 	if err != nil {
-		handleJsonResultError(err, nil, encoder)
-		return
-	}
-
-	// authToken is passed to the subscribe request so the event stream
-	// can handle closing a subscription if the authToken expires.
-	// If ACLs are disabled, a random token is generated and it will
-	// never be closed due to expiry.
-	authToken := args.AuthToken
-	if authToken == "" {
-		authToken = uuid.Generate()
-	}
-	subReq := &stream.SubscribeRequest{
-		Token:     authToken,
-		Topics:    args.Topics,
-		Index:     uint64(args.Index),
-		Namespace: args.Namespace,
-	}
-
-	// Check required ACL permissions for requested Topics
-	if aclObj != nil {
-		if err := aclCheckForEvents(subReq, aclObj); err != nil {
-			handleJsonResultError(structs.ErrPermissionDenied, helper.Int64ToPtr(403), encoder)
-			return
+		code := helper.Int64ToPtr(500)
+		if err == structs.ErrPermissionDenied {
+			code = helper.Int64ToPtr(403)
 		}
-	}
-
-	// Get the servers broker and subscribe
-	publisher, err := e.srv.State().EventBroker()
-	if err != nil {
-		handleJsonResultError(err, helper.Int64ToPtr(500), encoder)
+		handleJsonResultError(err, code, encoder)
 		return
 	}
 
@@ -83,12 +76,11 @@ func (e *Event) stream(conn io.ReadWriteCloser) {
 	defer cancel()
 
 	// start subscription to publisher
-	subscription, err := publisher.Subscribe(subReq)
+	subscription, err := event.OpenSubscription(serverAdapter{e.srv}, subReq)
 	if err != nil {
 		handleJsonResultError(err, helper.Int64ToPtr(500), encoder)
 		return
 	}
-	defer subscription.Unsubscribe()
 
 	errCh := make(chan error)
 
@@ -114,8 +106,30 @@ func (e *Event) stream(conn io.ReadWriteCloser) {
 
 	go func() {
 		defer cancel()
+		// subscription is only ever read and replaced from this goroutine,
+		// so it's also the one responsible for unsubscribing whichever
+		// subscription is current when the stream ends.
+		defer func() { subscription.Unsubscribe() }()
+
+		// Until the first batch is delivered, the last index the client
+		// has is the one it asked to start after.
+		lastIndex := subReq.Index
 		for {
 			events, err := subscription.Next(ctx)
+			if err == stream.ErrACLChanged {
+				// The token or a policy it depends on changed since we
+				// subscribed. Re-resolve it and, if still authorized,
+				// resubscribe from the last delivered index instead of
+				// tearing down the stream.
+				resubbed, rerr := e.resubscribeAfterACLChange(args, lastIndex)
+				if rerr != nil {
+					err = rerr
+				} else {
+					subscription.Unsubscribe()
+					subscription = resubbed
+					continue
+				}
+			}
 			if err != nil {
 				select {
 				case errCh <- err:
@@ -136,6 +150,7 @@ func (e *Event) stream(conn io.ReadWriteCloser) {
 				}
 				return
 			}
+			lastIndex = events.Index
 		}
 	}()
 
@@ -172,12 +187,74 @@ OUTER:
 	}
 
 	if streamErr != nil {
-		handleJsonResultError(streamErr, helper.Int64ToPtr(500), encoder)
+		if streamErr == stream.ErrShuttingDown {
+			handleJsonResultError(e.shuttingDownError(), helper.Int64ToPtr(503), encoder)
+			return
+		}
+
+		code := helper.Int64ToPtr(500)
+		if streamErr == structs.ErrPermissionDenied {
+			code = helper.Int64ToPtr(403)
+		}
+		handleJsonResultError(streamErr, code, encoder)
 		return
 	}
 
 }
 
+// shuttingDownError builds the error sent to a client when this server is
+// entering graceful shutdown, appending the RPC addresses of any other
+// known servers in the region so client SDKs can reconnect immediately
+// instead of retrying the server that is on its way down.
+func (e *Event) shuttingDownError() error {
+	msg := "server_shutting_down"
+	if peers := e.peerAddrs(); len(peers) > 0 {
+		msg = fmt.Sprintf("%s; reconnect to one of: %s", msg, strings.Join(peers, ","))
+	}
+	return errors.New(msg)
+}
+
+// peerAddrs best-effort collects the RPC addresses of other known servers in
+// this region, excluding this server's own address - a client told to
+// reconnect to one of these must not be pointed back at the server that is
+// shutting down.
+func (e *Event) peerAddrs() []string {
+	if e.srv.serverLookup == nil {
+		return nil
+	}
+
+	var selfAddr string
+	if e.srv.config.RPCAddr != nil {
+		selfAddr = e.srv.config.RPCAddr.String()
+	}
+
+	var addrs []string
+	for _, srv := range e.srv.serverLookup.Servers() {
+		if srv.Region != e.srv.config.Region {
+			continue
+		}
+		if addr := srv.Addr.String(); addr != selfAddr {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// resubscribeAfterACLChange re-authorizes the stream's token and, if it is
+// still permitted to see the requested topics, opens a fresh subscription
+// picking up just after lastIndex. It is called when a subscription is
+// force-closed due to an ACL token or policy change so the streaming RPC
+// can recover without the client having to reconnect.
+func (e *Event) resubscribeAfterACLChange(args structs.EventStreamRequest, lastIndex uint64) (*stream.Subscription, error) {
+	subReq, err := event.Authorize(serverAdapter{e.srv}, args)
+	if err != nil {
+		return nil, err
+	}
+
+	subReq.Index = lastIndex
+	return event.OpenSubscription(serverAdapter{e.srv}, subReq)
+}
+
 func (e *Event) forwardStreamingRPC(region string, method string, args interface{}, in io.ReadWriteCloser) error {
 	server, err := e.srv.findRegionServer(region)
 	if err != nil {
@@ -216,47 +293,3 @@ func handleJsonResultError(err error, code *int64, encoder *codec.Encoder) {
 		Error: structs.NewRpcError(err, code),
 	})
 }
-
-func aclCheckForEvents(subReq *stream.SubscribeRequest, aclObj *acl.ACL) error {
-	if len(subReq.Topics) == 0 {
-		return fmt.Errorf("invalid topic request")
-	}
-
-	reqPolicies := make(map[string]struct{})
-	var required = struct{}{}
-
-	for topic := range subReq.Topics {
-		switch topic {
-		case structs.TopicDeployment, structs.TopicEval,
-			structs.TopicAlloc, structs.TopicJob:
-			if _, ok := reqPolicies[acl.NamespaceCapabilityReadJob]; !ok {
-				reqPolicies[acl.NamespaceCapabilityReadJob] = required
-			}
-		case structs.TopicNode:
-			reqPolicies["node-read"] = required
-		case structs.TopicAll:
-			reqPolicies["management"] = required
-		default:
-			return fmt.Errorf("unknown topic %s", topic)
-		}
-	}
-
-	for checks := range reqPolicies {
-		switch checks {
-		case acl.NamespaceCapabilityReadJob:
-			if ok := aclObj.AllowNsOp(subReq.Namespace, acl.NamespaceCapabilityReadJob); !ok {
-				return structs.ErrPermissionDenied
-			}
-		case "node-read":
-			if ok := aclObj.AllowNodeRead(); !ok {
-				return structs.ErrPermissionDenied
-			}
-		case "management":
-			if ok := aclObj.IsManagement(); !ok {
-				return structs.ErrPermissionDenied
-			}
-		}
-	}
-
-	return nil
-}
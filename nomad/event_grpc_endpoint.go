@@ -0,0 +1,220 @@
+package nomad
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/hashicorp/nomad/nomad/event"
+	"github.com/hashicorp/nomad/nomad/event/eventpb"
+	"github.com/hashicorp/nomad/nomad/stream"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// nomadTokenMetadataKey is the gRPC metadata key EventGRPCServer reads the
+// ACL token from, mirroring the X-Nomad-Token header Nomad's HTTP API
+// already uses for the same purpose.
+const nomadTokenMetadataKey = "x-nomad-token"
+
+// EventGRPCServer is the gRPC equivalent of Event.Stream (event_endpoint.go)
+// for third-party SDKs and sidecars that can't speak Nomad's internal
+// msgpack/yamux streaming RPC framing. It shares its ACL check and
+// subscribe logic with Event.stream via the nomad/event package so the two
+// transports can't drift apart. Nothing in this tree registers it on a gRPC
+// server; see newEventGRPCServer.
+type EventGRPCServer struct {
+	srv *Server
+}
+
+// newEventGRPCServer has no caller in this source tree: registering it
+// against the shared gRPC server happens wherever that server is
+// bootstrapped, which isn't part of this tree either. Confirm that
+// bootstrap change (the grpc.ServiceDesc registration of
+// eventpb.EventServiceServiceDesc against *EventGRPCServer) exists before
+// merging, or this endpoint is unreachable in production.
+func newEventGRPCServer(srv *Server) *EventGRPCServer {
+	return &EventGRPCServer{srv: srv}
+}
+
+// Subscribe implements eventpb.EventServiceServer.
+func (e *EventGRPCServer) Subscribe(req *eventpb.SubscribeRequest, respStream eventpb.EventService_SubscribeServer) error {
+	if req.Region != "" && req.Region != e.srv.config.Region {
+		return e.forwardSubscribe(req, respStream)
+	}
+
+	var args structs.EventStreamRequest
+	args.Topics = topicsFromProto(req.Topics)
+	args.Namespace = req.Namespace
+	args.Index = req.Index
+	args.Region = req.Region
+	args.Filter = req.Filter
+	args.AuthToken = tokenFromContext(respStream.Context())
+
+	sink := &grpcEventSink{stream: respStream}
+	return grpcStatusFromErr(event.Subscribe(respStream.Context(), serverAdapter{e.srv}, args, sink))
+}
+
+// forwardSubscribe proxies a Subscribe call to the server actually hosting
+// req.Region, the gRPC counterpart of Event.forwardStreamingRPC.
+func (e *EventGRPCServer) forwardSubscribe(req *eventpb.SubscribeRequest, respStream eventpb.EventService_SubscribeServer) error {
+	// Incoming metadata isn't copied to an outgoing call automatically, so
+	// without this the remote server would see no x-nomad-token at all and
+	// either reject or run the forwarded subscription as anonymous.
+	ctx := respStream.Context()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+
+	server, err := e.srv.findRegionServer(req.Region)
+	if err != nil {
+		return grpcStatusFromErr(err)
+	}
+
+	dialOpt, err := e.regionForwardDialOption(req.Region)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	conn, err := grpc.DialContext(ctx, server.Addr.String(), dialOpt)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer conn.Close()
+
+	upstream, err := eventpb.NewEventServiceClient(conn).Subscribe(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		evt, err := upstream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := respStream.Send(evt); err != nil {
+			return err
+		}
+	}
+}
+
+// regionForwardDialOption returns the grpc.DialOption forwardSubscribe
+// should dial targetRegion's server with: mTLS built from the same
+// cert/key/CA Nomad's server-to-server RPC already uses when RPC TLS is
+// enabled, since a forwarded subscription carries both the caller's ACL
+// token and potentially sensitive event payloads between servers.
+func (e *EventGRPCServer) regionForwardDialOption(targetRegion string) (grpc.DialOption, error) {
+	tlsConf := e.srv.config.TLSConfig
+	if tlsConf == nil || !tlsConf.EnableRPC {
+		return grpc.WithInsecure(), nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(tlsConf.CertFile, tlsConf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load RPC TLS cert/key: %w", err)
+	}
+
+	caPEM, err := ioutil.ReadFile(tlsConf.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RPC TLS CA file: %w", err)
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("failed to parse RPC TLS CA file %q", tlsConf.CAFile)
+	}
+
+	// ServerName must match targetRegion, the region actually being
+	// dialed, not e.srv.config.Region (this server's own region) -
+	// forwardSubscribe only reaches here when the two differ.
+	return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+		ServerName:   fmt.Sprintf("server.%s.nomad", targetRegion),
+	})), nil
+}
+
+// tokenFromContext extracts the ACL token a gRPC caller sent via the
+// "x-nomad-token" metadata key.
+func tokenFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	vals := md.Get(nomadTokenMetadataKey)
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+func topicsFromProto(topics map[string]*eventpb.TopicFilter) map[structs.Topic][]string {
+	if len(topics) == 0 {
+		return nil
+	}
+
+	out := make(map[structs.Topic][]string, len(topics))
+	for topic, filter := range topics {
+		var keys []string
+		if filter != nil {
+			keys = filter.Keys
+		}
+		out[structs.Topic(topic)] = keys
+	}
+	return out
+}
+
+// grpcEventSink adapts a gRPC response stream to the event.Sink interface
+// event.Subscribe expects.
+type grpcEventSink struct {
+	stream eventpb.EventService_SubscribeServer
+}
+
+func (s *grpcEventSink) Send(events structs.Events) error {
+	for _, e := range events.Events {
+		payload, err := json.Marshal(e.Payload)
+		if err != nil {
+			return err
+		}
+
+		if err := s.stream.Send(&eventpb.Event{
+			Topic:     string(e.Topic),
+			Type:      e.Type,
+			Key:       e.Key,
+			Namespace: e.Namespace,
+			Index:     e.Index,
+			Payload:   payload,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grpcStatusFromErr maps the sentinel errors event.Subscribe and the
+// nomad/stream package return onto gRPC status codes.
+func grpcStatusFromErr(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case structs.ErrPermissionDenied:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case stream.ErrShuttingDown:
+		return status.Error(codes.Unavailable, err.Error())
+	case stream.ErrACLChanged, stream.ErrSubForceClosed:
+		return status.Error(codes.Aborted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,19 @@
+package nomad
+
+// notifyEventBrokerShutdown force-closes every active Event.Stream
+// subscription so the streaming RPC goroutines in event_endpoint.go get a
+// chance to send clients a final "server_shutting_down" frame, with a
+// reconnect hint, before this server's RPC listeners go away.
+//
+// Server.Shutdown must call this ahead of closing the RPC listeners so
+// subscribers reconnect to another region server instead of retrying the
+// one that is going down; server.go isn't part of this source tree, so
+// that call site can't be added here yet, and without it this method is
+// unreachable in production.
+func (s *Server) notifyEventBrokerShutdown() {
+	broker, err := s.State().EventBroker()
+	if err != nil {
+		return
+	}
+	broker.Shutdown()
+}
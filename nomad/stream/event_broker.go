@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// subState tracks the lifecycle of an EventBroker.
+type subState int32
+
+const (
+	subStateRunning subState = iota
+	subStateShuttingDown
+)
+
+// EventBroker fans out published events to subscribers. Subscribers are
+// tracked by the ACL token they authenticated with so the broker can
+// force-close them if that token, or a policy it depends on, changes.
+type EventBroker struct {
+	mu sync.Mutex
+
+	// subsByToken indexes active subscriptions by the token they were
+	// created with, so ACL changes can force-close the affected
+	// subscriptions without scanning every subscriber.
+	subsByToken map[string]map[*Subscription]struct{}
+
+	// state reflects whether the broker is still accepting subscriptions
+	// or is draining them ahead of a graceful server shutdown.
+	state subState
+
+	// buffers holds one ring buffer per Subject that a live subscription is
+	// currently reading from, reference-counted so a buffer is evicted as
+	// soon as its last subscriber goes away instead of being retained for
+	// every distinct Subject the broker has ever seen.
+	buffers map[Subject]*bufferRef
+
+	// wildcard carries every published event and backs subscriptions that
+	// asked for TopicAll, or for every key on a topic rather than specific
+	// ones.
+	wildcard *eventBuffer
+}
+
+// bufferRef pairs a Subject's ring buffer with a count of the
+// subscriptions currently reading from it.
+type bufferRef struct {
+	buf  *eventBuffer
+	refs int
+}
+
+// NewEventBroker returns an EventBroker ready to accept subscriptions.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subsByToken: make(map[string]map[*Subscription]struct{}),
+		buffers:     make(map[Subject]*bufferRef),
+		wildcard:    newEventBuffer(),
+	}
+}
+
+// Subscribe registers a new subscription against the broker and resolves
+// the per-Subject buffers it should read from.
+func (b *EventBroker) Subscribe(req *SubscribeRequest) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == subStateShuttingDown {
+		return nil, ErrShuttingDown
+	}
+
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects, buffers := b.resolveBuffersLocked(req)
+	sub := &Subscription{
+		req:       req,
+		subjects:  subjects,
+		buffers:   buffers,
+		filter:    filter,
+		lastIndex: req.Index,
+		closeCh:   make(chan struct{}),
+	}
+	sub.releaseFn = func() { b.unsubscribe(sub) }
+
+	subs, ok := b.subsByToken[req.Token]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		b.subsByToken[req.Token] = subs
+	}
+	subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// resolveBuffersLocked returns the Subjects (nil for the wildcard buffer)
+// and the buffers req should read from: the Subjects it explicitly asked
+// for, or the wildcard buffer if it asked for TopicAll, every key on a
+// topic, or didn't populate Subjects at all. Each per-Subject buffer
+// returned has its reference count bumped; the caller is responsible for
+// releasing it via releaseBuffersLocked when the subscription goes away.
+// b.mu must be held.
+func (b *EventBroker) resolveBuffersLocked(req *SubscribeRequest) ([]Subject, []*eventBuffer) {
+	subjects := req.Subjects
+	if subjects == nil {
+		var wildcard bool
+		subjects, wildcard = SubjectsFromTopics(req.Topics)
+		if wildcard {
+			return nil, []*eventBuffer{b.wildcard}
+		}
+	}
+	if len(subjects) == 0 {
+		return nil, []*eventBuffer{b.wildcard}
+	}
+
+	bufs := make([]*eventBuffer, 0, len(subjects))
+	for _, subj := range subjects {
+		ref, ok := b.buffers[subj]
+		if !ok {
+			ref = &bufferRef{buf: newEventBuffer()}
+			b.buffers[subj] = ref
+		}
+		ref.refs++
+		bufs = append(bufs, ref.buf)
+	}
+	return subjects, bufs
+}
+
+// releaseBuffersLocked drops subjects' reference on their per-Subject
+// buffers, evicting any buffer that no subscription is reading from
+// anymore. b.mu must be held.
+func (b *EventBroker) releaseBuffersLocked(subjects []Subject) {
+	for _, subj := range subjects {
+		ref, ok := b.buffers[subj]
+		if !ok {
+			continue
+		}
+		ref.refs--
+		if ref.refs <= 0 {
+			delete(b.buffers, subj)
+		}
+	}
+}
+
+func (b *EventBroker) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if subs, ok := b.subsByToken[sub.req.Token]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(b.subsByToken, sub.req.Token)
+		}
+	}
+
+	b.releaseBuffersLocked(sub.subjects)
+}
+
+// CloseSubscriptionsForTokens force-closes every subscription created with
+// one of the given ACL tokens, raising ErrACLChanged on the next call to
+// Subscription.Next rather than a generic ErrSubForceClosed. It should be
+// called with the affected token's SecretID whenever the state store
+// applies an ACL token or policy update/delete that could affect an
+// in-flight event stream, i.e. from the FSM's applyACLTokenUpsert,
+// applyACLTokenDelete, applyACLPolicyUpsert, and applyACLPolicyDelete
+// handlers, each passed the token(s) implicated by that change.
+func (b *EventBroker) CloseSubscriptionsForTokens(tokenSecretIDs []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, token := range tokenSecretIDs {
+		subs, ok := b.subsByToken[token]
+		if !ok {
+			continue
+		}
+		for sub := range subs {
+			sub.forceClose(ErrACLChanged)
+		}
+		delete(b.subsByToken, token)
+	}
+}
+
+// Shutdown marks the broker as shutting down, rejects any further calls to
+// Subscribe, and force-closes every existing subscription with
+// ErrShuttingDown so streaming RPCs get a chance to hand clients a
+// reconnect hint before the server's RPC listeners close.
+func (b *EventBroker) Shutdown() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = subStateShuttingDown
+	for _, subs := range b.subsByToken {
+		for sub := range subs {
+			sub.forceClose(ErrShuttingDown)
+		}
+	}
+	b.subsByToken = make(map[string]map[*Subscription]struct{})
+}
+
+// Publish fans events out to the per-Subject buffer each one belongs to,
+// plus the wildcard buffer, so that subscriptions only ever have to walk
+// the handful of buffers they're actually interested in. A per-Subject
+// buffer only exists while at least one subscription is reading from it
+// (see resolveBuffersLocked/releaseBuffersLocked), so Publish writes to one
+// only if it's already there rather than creating it on the fly; an event
+// for a Subject nobody is subscribed to is still captured by the wildcard
+// buffer.
+func (b *EventBroker) Publish(events structs.Events) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range events.Events {
+		subj := eventSubject(e)
+		if ref, ok := b.buffers[subj]; ok {
+			ref.buf.append(e)
+		}
+		b.wildcard.append(e)
+	}
+}
@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// BenchmarkEventBroker_SubjectFanout fans N subscribers out across M
+// subjects. Each iteration first publishes one event per subject from
+// concurrent goroutines, then has a reader goroutine per subscriber call
+// Next concurrently. Because Subscription.Next only walks the
+// buffers it resolved at Subscribe time, throughput should scale close to
+// linearly with GOMAXPROCS instead of flattening out as subscriber count
+// grows, the way a single shared, linearly-scanned buffer would.
+func BenchmarkEventBroker_SubjectFanout(b *testing.B) {
+	const numSubscribers = 2000
+	const numSubjects = 200
+
+	broker := NewEventBroker()
+
+	subs := make([]*Subscription, numSubscribers)
+	for i := 0; i < numSubscribers; i++ {
+		key := strconv.Itoa(i % numSubjects)
+		sub, err := broker.Subscribe(&SubscribeRequest{
+			Token:    "bench-token",
+			Topics:   map[structs.Topic][]string{structs.TopicJob: {key}},
+			Subjects: []Subject{{Topic: structs.TopicJob, Key: key}},
+		})
+		if err != nil {
+			b.Fatalf("subscribe: %v", err)
+		}
+		subs[i] = sub
+	}
+
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	// index keeps rising across iterations so every event is newer than
+	// what each subscriber has already read.
+	var index uint64
+	for n := 0; n < b.N; n++ {
+		var wg sync.WaitGroup
+
+		wg.Add(numSubjects)
+		for s := 0; s < numSubjects; s++ {
+			s := s
+			go func() {
+				defer wg.Done()
+				idx := atomic.AddUint64(&index, 1)
+				broker.Publish(structs.Events{
+					Index: idx,
+					Events: []structs.Event{
+						{
+							Topic: structs.TopicJob,
+							Key:   strconv.Itoa(s),
+							Index: idx,
+						},
+					},
+				})
+			}()
+		}
+		wg.Wait()
+
+		wg.Add(numSubscribers)
+		for i := 0; i < numSubscribers; i++ {
+			i := i
+			go func() {
+				defer wg.Done()
+				if _, err := subs[i].Next(ctx); err != nil {
+					b.Errorf("next: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// eventBufferSize bounds how many events are retained per Subject before
+// the oldest are evicted. Subscribers that fall further behind than this
+// must resubscribe from the broker's current index.
+const eventBufferSize = 1024
+
+// eventBuffer is a small ring buffer of events for a single Subject (or the
+// wildcard buffer). It's intentionally simple: a mutex-guarded slice plus a
+// channel that's closed and replaced whenever new events are appended, so
+// readers can block on "more data for this buffer" without polling.
+type eventBuffer struct {
+	mu       sync.Mutex
+	events   []structs.Event
+	notifyCh chan struct{}
+}
+
+func newEventBuffer() *eventBuffer {
+	return &eventBuffer{notifyCh: make(chan struct{})}
+}
+
+// append adds an event to the buffer, evicting the oldest event if the
+// buffer is full, and wakes any readers waiting on this buffer.
+func (b *eventBuffer) append(e structs.Event) {
+	b.mu.Lock()
+	b.events = append(b.events, e)
+	if len(b.events) > eventBufferSize {
+		b.events = b.events[len(b.events)-eventBufferSize:]
+	}
+	notifyCh := b.notifyCh
+	b.notifyCh = make(chan struct{})
+	b.mu.Unlock()
+
+	close(notifyCh)
+}
+
+// since returns every buffered event with an index greater than lastIndex,
+// along with the channel that will close the next time this buffer
+// receives an event.
+func (b *eventBuffer) since(lastIndex uint64) ([]structs.Event, chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []structs.Event
+	for _, e := range b.events {
+		if e.Index > lastIndex {
+			out = append(out, e)
+		}
+	}
+	return out, b.notifyCh
+}
@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-bexpr"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// FilterableEvent is the view of structs.Event exposed to Filter
+// expressions. Only fields every topic's ACL check already requires read
+// access to are exposed here; a filter referencing anything else (e.g.
+// payload internals a caller might not be allowed to read) fails to
+// compile because bexpr can't resolve the selector against this struct.
+type FilterableEvent struct {
+	Topic     string
+	Type      string
+	Key       string
+	Namespace string
+}
+
+func filterableEvent(e structs.Event) FilterableEvent {
+	return FilterableEvent{
+		Topic:     string(e.Topic),
+		Type:      e.Type,
+		Key:       e.Key,
+		Namespace: e.Namespace,
+	}
+}
+
+// compileFilter parses and validates a go-bexpr filter expression against
+// FilterableEvent. It returns a nil evaluator (meaning "everything
+// matches") for an empty expression.
+func compileFilter(expr string) (*bexpr.Evaluator, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	evaluator, err := bexpr.CreateEvaluator(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event filter: %w", err)
+	}
+
+	// Evaluating once against the zero value forces bexpr to resolve every
+	// selector in the expression against FilterableEvent's fields. A
+	// selector outside that set - including anything in an event's
+	// Payload - errors here instead of silently matching nothing forever.
+	if _, err := evaluator.Evaluate(FilterableEvent{}); err != nil {
+		return nil, fmt.Errorf("event filter references a field that cannot be filtered on: %w", err)
+	}
+
+	return evaluator, nil
+}
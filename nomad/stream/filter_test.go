@@ -0,0 +1,39 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileFilter_Empty(t *testing.T) {
+	evaluator, err := compileFilter("")
+	require.NoError(t, err)
+	require.Nil(t, evaluator)
+}
+
+func TestCompileFilter_RejectsUnknownField(t *testing.T) {
+	_, err := compileFilter(`Payload.Job.ID == "web"`)
+	require.Error(t, err)
+}
+
+func TestCompileFilter_MatchesFilterableFields(t *testing.T) {
+	evaluator, err := compileFilter(`Key == "web" and Namespace == "default"`)
+	require.NoError(t, err)
+	require.NotNil(t, evaluator)
+
+	ok, err := evaluator.Evaluate(filterableEvent(structs.Event{
+		Key:       "web",
+		Namespace: "default",
+	}))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = evaluator.Evaluate(filterableEvent(structs.Event{
+		Key:       "other",
+		Namespace: "default",
+	}))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,39 @@
+package stream
+
+import "github.com/hashicorp/nomad/nomad/structs"
+
+// Subject identifies a single stream of events within a topic, such as one
+// job, allocation, deployment, or node. Routing by Subject lets the broker
+// hand a subscriber only the buffers it actually asked for instead of
+// making every subscriber walk every event on the topic.
+type Subject struct {
+	Topic structs.Topic
+	Key   string
+}
+
+// eventSubject derives the Subject an event belongs to from its Topic and
+// Key.
+func eventSubject(e structs.Event) Subject {
+	return Subject{Topic: e.Topic, Key: e.Key}
+}
+
+// SubjectsFromTopics flattens a SubscribeRequest-style topic/key map into
+// the Subjects the broker should route on. A topic requested with no keys
+// means "everything on this topic", which the broker can only serve out of
+// the wildcard buffer, so SubjectsFromTopics reports wildcard == true in
+// that case instead of returning a partial Subject list.
+func SubjectsFromTopics(topics map[structs.Topic][]string) (subjects []Subject, wildcard bool) {
+	if _, ok := topics[structs.TopicAll]; ok {
+		return nil, true
+	}
+
+	for topic, keys := range topics {
+		if len(keys) == 0 {
+			return nil, true
+		}
+		for _, key := range keys {
+			subjects = append(subjects, Subject{Topic: topic, Key: key})
+		}
+	}
+	return subjects, false
+}
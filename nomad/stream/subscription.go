@@ -0,0 +1,266 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/go-bexpr"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// NamespacedTopics are the Topics whose events are scoped to a namespace,
+// so matchesRequest only compares Namespace for these; e.g. TopicNode
+// events are cluster-scoped and always match regardless of
+// SubscribeRequest.Namespace. nomad/event.Authorize's ACL check uses this
+// same set to decide which topics require namespace-scoped read-job
+// authorization, so the two can't drift apart on what counts as
+// namespaced.
+var NamespacedTopics = map[structs.Topic]bool{
+	structs.TopicDeployment: true,
+	structs.TopicEval:       true,
+	structs.TopicAlloc:      true,
+	structs.TopicJob:        true,
+}
+
+var (
+	// ErrSubForceClosed is returned to a subscriber when its subscription is
+	// forcibly closed by the broker without a more specific reason. The
+	// broker's own force-close paths always give one (ErrACLChanged or
+	// ErrShuttingDown).
+	ErrSubForceClosed = errors.New("subscription closed by server, please retry")
+
+	// ErrACLChanged is returned to a subscriber when its subscription is
+	// force-closed specifically because the ACL token or policy it was
+	// created with has changed. Callers that see this error should
+	// re-resolve the token and, if it is still valid, resubscribe rather
+	// than tearing down the whole RPC.
+	ErrACLChanged = errors.New("subscription closed by server, ACL token or policy changed")
+
+	// ErrSubscriptionClosed is returned once a Subscription has already been
+	// released by a call to Unsubscribe.
+	ErrSubscriptionClosed = errors.New("subscription closed by unsubscribe")
+
+	// ErrShuttingDown is returned to every subscriber when the broker's
+	// server begins graceful shutdown. Unlike ErrSubForceClosed, callers
+	// should not retry against the same server; Event.stream turns this
+	// into a final frame carrying a reconnect hint instead of a bare error.
+	ErrShuttingDown = errors.New("server is shutting down")
+)
+
+// SubscribeRequest describes the event subscription a client wants to
+// establish against the EventBroker.
+type SubscribeRequest struct {
+	// Token is the ACL token the subscriber authenticated with. The broker
+	// tracks subscriptions by token so it can force-close them if the token
+	// is later updated or deleted.
+	Token string
+
+	// Topics is a map of topic to the keys within that topic the subscriber
+	// is interested in. An empty key slice means all keys for that topic.
+	Topics map[structs.Topic][]string
+
+	// Subjects is the flattened (Topic, Key) routing list derived from
+	// Topics. When set, the broker only walks the per-Subject buffers
+	// listed here instead of every event on the topic. It's left nil for
+	// requests that want every key on a topic, which fall back to the
+	// broker's wildcard buffer.
+	Subjects []Subject
+
+	// Namespace restricts the subscription to events in the given
+	// namespace, where the topic is namespace scoped.
+	Namespace string
+
+	// Filter is an optional go-bexpr expression evaluated against each
+	// event's FilterableEvent view before it's delivered. Topics/Subjects
+	// already short-circuit most irrelevant events before a filter ever
+	// has to run; Filter narrows what's left, e.g. down to one job within
+	// a namespace-wide Alloc subscription.
+	Filter string
+
+	// Index is the last index the subscriber has already received. The
+	// broker replays any buffered events after this index before streaming
+	// new events.
+	Index uint64
+}
+
+// Subscription is handed back to a caller of EventBroker.Subscribe. Next
+// blocks until new events are available, the context is cancelled, or the
+// broker force-closes the subscription (e.g. an ACL change or shutdown).
+type Subscription struct {
+	req *SubscribeRequest
+
+	// subjects is the set of Subjects this subscription holds a buffer
+	// reference for, nil if it reads from the wildcard buffer instead. The
+	// broker releases these references, evicting any buffer that ends up
+	// unreferenced, when the subscription is unsubscribed.
+	subjects []Subject
+
+	// buffers holds only the per-Subject (or wildcard) buffers this
+	// subscription actually cares about, resolved once at Subscribe time so
+	// Next never has to walk buffers for subjects it didn't ask for.
+	buffers []*eventBuffer
+
+	// filter is the compiled form of req.Filter, or nil if req.Filter was
+	// empty. Next drops any event that doesn't match it instead of
+	// delivering it to the caller.
+	filter *bexpr.Evaluator
+
+	lastIndex uint64
+
+	// closeCh is closed by the broker to force-close this subscription.
+	closeCh chan struct{}
+
+	// closeReason is set by the broker before closeCh is closed and
+	// explains why, e.g. ErrACLChanged.
+	closeReason error
+
+	// unsubscribeGuard makes Unsubscribe idempotent: releaseFn shares
+	// bufferRef.refs with every other subscriber on the same Subject, so a
+	// second call must not double-release it.
+	unsubscribeGuard sync.Once
+	releaseFn        func()
+}
+
+// Next returns the next batch of events for this subscription, blocking
+// until one is available, ctx is done, or the subscription is force-closed
+// by the broker. It only scans the buffers resolved for this subscription's
+// Subjects, not the full set of buffers the broker is maintaining.
+func (s *Subscription) Next(ctx context.Context) (structs.Events, error) {
+	for {
+		select {
+		case <-s.closeCh:
+			if s.closeReason != nil {
+				return structs.Events{}, s.closeReason
+			}
+			return structs.Events{}, ErrSubForceClosed
+		case <-ctx.Done():
+			return structs.Events{}, ctx.Err()
+		default:
+		}
+
+		var collected []structs.Event
+		waitChs := make([]chan struct{}, 0, len(s.buffers))
+		for _, buf := range s.buffers {
+			events, notifyCh := buf.since(s.lastIndex)
+			collected = append(collected, events...)
+			waitChs = append(waitChs, notifyCh)
+		}
+
+		if len(collected) > 0 {
+			sort.Slice(collected, func(i, j int) bool { return collected[i].Index < collected[j].Index })
+			// Advance past every scanned event regardless of whether it
+			// matches the filter, so a filtered-out event is never
+			// rescanned on the next call.
+			s.lastIndex = collected[len(collected)-1].Index
+
+			matched := s.filterEvents(collected)
+			if len(matched) > 0 {
+				return structs.Events{Index: s.lastIndex, Events: matched}, nil
+			}
+			continue
+		}
+
+		if err := s.waitForMore(ctx, waitChs); err != nil {
+			return structs.Events{}, err
+		}
+	}
+}
+
+// matchesRequest reports whether e falls within s.req's Topics and
+// Namespace.
+func (s *Subscription) matchesRequest(e structs.Event) bool {
+	if _, ok := s.req.Topics[structs.TopicAll]; ok {
+		return true
+	}
+
+	keys, ok := s.req.Topics[e.Topic]
+	if !ok {
+		return false
+	}
+
+	if len(keys) > 0 {
+		var keyMatch bool
+		for _, key := range keys {
+			if key == e.Key {
+				keyMatch = true
+				break
+			}
+		}
+		if !keyMatch {
+			return false
+		}
+	}
+
+	if s.req.Namespace != "" && NamespacedTopics[e.Topic] && e.Namespace != s.req.Namespace {
+		return false
+	}
+
+	return true
+}
+
+// filterEvents drops events this subscription never asked for: those
+// outside its req.Topics/req.Namespace (see matchesRequest - the buffers
+// Next scans, including the wildcard buffer, can carry events beyond what
+// was requested) and, for events that do, any that don't match s.filter.
+// With no filter set every event matching the request topics and
+// namespace passes through.
+func (s *Subscription) filterEvents(events []structs.Event) []structs.Event {
+	matched := make([]structs.Event, 0, len(events))
+	for _, e := range events {
+		if !s.matchesRequest(e) {
+			continue
+		}
+		if s.filter != nil {
+			ok, err := s.filter.Evaluate(filterableEvent(e))
+			if err != nil || !ok {
+				continue
+			}
+		}
+		matched = append(matched, e)
+	}
+	return matched
+}
+
+// waitForMore blocks until one of the subscription's buffers receives a new
+// event, ctx is done, or the broker force-closes the subscription.
+func (s *Subscription) waitForMore(ctx context.Context, waitChs []chan struct{}) error {
+	cases := make([]reflect.SelectCase, 0, len(waitChs)+2)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.closeCh)})
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	for _, ch := range waitChs {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+
+	chosen, _, _ := reflect.Select(cases)
+	switch chosen {
+	case 0:
+		if s.closeReason != nil {
+			return s.closeReason
+		}
+		return ErrSubForceClosed
+	case 1:
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// Unsubscribe releases the subscription's resources. It is safe to call
+// multiple times; only the first call has any effect.
+func (s *Subscription) Unsubscribe() {
+	s.unsubscribeGuard.Do(func() {
+		if s.releaseFn != nil {
+			s.releaseFn()
+		}
+	})
+}
+
+// forceClose closes the subscription with the given reason. Only the
+// EventBroker calls this, never the subscriber itself.
+func (s *Subscription) forceClose(reason error) {
+	s.closeReason = reason
+	close(s.closeCh)
+}
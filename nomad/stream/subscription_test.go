@@ -0,0 +1,280 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEventBroker_CloseSubscriptionsForTokens_ACLChanged asserts that
+// force-closing a subscription because its token was updated or revoked
+// surfaces ErrACLChanged rather than the generic ErrSubForceClosed, so
+// Event.stream knows it can try to recover the stream instead of tearing
+// the RPC down.
+func TestEventBroker_CloseSubscriptionsForTokens_ACLChanged(t *testing.T) {
+	broker := NewEventBroker()
+
+	sub, err := broker.Subscribe(&SubscribeRequest{
+		Token:  "test-token",
+		Topics: map[structs.Topic][]string{structs.TopicJob: {}},
+	})
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := sub.Next(context.Background())
+		errCh <- err
+	}()
+
+	broker.CloseSubscriptionsForTokens([]string{"test-token"})
+
+	require.Equal(t, ErrACLChanged, <-errCh)
+}
+
+// TestEventBroker_CloseSubscriptionsForTokens_Unrelated asserts that
+// closing subscriptions for one token does not affect subscriptions
+// belonging to other tokens.
+func TestEventBroker_CloseSubscriptionsForTokens_Unrelated(t *testing.T) {
+	broker := NewEventBroker()
+
+	sub, err := broker.Subscribe(&SubscribeRequest{
+		Token:  "other-token",
+		Topics: map[structs.Topic][]string{structs.TopicJob: {}},
+	})
+	require.NoError(t, err)
+
+	broker.CloseSubscriptionsForTokens([]string{"test-token"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, err = sub.Next(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+// TestEventBroker_Shutdown asserts that Shutdown force-closes existing
+// subscriptions with ErrShuttingDown and rejects new ones.
+func TestEventBroker_Shutdown(t *testing.T) {
+	broker := NewEventBroker()
+
+	sub, err := broker.Subscribe(&SubscribeRequest{
+		Token:  "test-token",
+		Topics: map[structs.Topic][]string{structs.TopicJob: {}},
+	})
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := sub.Next(context.Background())
+		errCh <- err
+	}()
+
+	broker.Shutdown()
+	require.Equal(t, ErrShuttingDown, <-errCh)
+
+	_, err = broker.Subscribe(&SubscribeRequest{
+		Token:  "another-token",
+		Topics: map[structs.Topic][]string{structs.TopicJob: {}},
+	})
+	require.Equal(t, ErrShuttingDown, err)
+}
+
+// TestEventBroker_CloseSubscriptionsForTokens_Resubscribe simulates the
+// full ACL-change recovery path Event.stream drives in production: a
+// subscriber mid-stream has its token revoked, sees ErrACLChanged instead
+// of a hard failure, and resubscribes from its last delivered index
+// without missing or re-delivering any event.
+func TestEventBroker_CloseSubscriptionsForTokens_Resubscribe(t *testing.T) {
+	broker := NewEventBroker()
+
+	subReq := &SubscribeRequest{
+		Token:  "test-token",
+		Topics: map[structs.Topic][]string{structs.TopicJob: {}},
+	}
+
+	sub, err := broker.Subscribe(subReq)
+	require.NoError(t, err)
+
+	broker.Publish(structs.Events{Events: []structs.Event{
+		{Topic: structs.TopicJob, Key: "web", Index: 1},
+	}})
+
+	events, err := sub.Next(context.Background())
+	require.NoError(t, err)
+	lastIndex := events.Index
+
+	// The state store observes the token being updated or revoked and
+	// force-closes every subscription created with it.
+	broker.CloseSubscriptionsForTokens([]string{"test-token"})
+
+	_, err = sub.Next(context.Background())
+	require.Equal(t, ErrACLChanged, err)
+	sub.Unsubscribe()
+
+	// Event.stream re-resolves the token and, if it's still authorized,
+	// resubscribes from the last index it delivered rather than tearing
+	// the RPC down.
+	resubReq := *subReq
+	resubReq.Index = lastIndex
+	resub, err := broker.Subscribe(&resubReq)
+	require.NoError(t, err)
+	defer resub.Unsubscribe()
+
+	broker.Publish(structs.Events{Events: []structs.Event{
+		{Topic: structs.TopicJob, Key: "web", Index: 2},
+	}})
+
+	events, err = resub.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	require.Equal(t, uint64(2), events.Events[0].Index)
+}
+
+// TestEventBroker_Next_MatchesRequestTopics asserts that Next only
+// delivers events for the Topics (and, where the topic is namespaced, the
+// Namespace) a subscription actually requested, even when every-key-on-a-
+// topic routes it to the broker's wildcard buffer alongside every other
+// topic/namespace's events.
+func TestEventBroker_Next_MatchesRequestTopics(t *testing.T) {
+	broker := NewEventBroker()
+
+	sub, err := broker.Subscribe(&SubscribeRequest{
+		Token:     "node-read-token",
+		Topics:    map[structs.Topic][]string{structs.TopicNode: {}},
+		Namespace: "default",
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	broker.Publish(structs.Events{Events: []structs.Event{
+		{Topic: structs.TopicJob, Key: "web", Namespace: "default", Index: 1},
+		{Topic: structs.TopicNode, Key: "node-1", Index: 2},
+		{Topic: structs.TopicJob, Key: "web", Namespace: "other", Index: 3},
+	}})
+
+	events, err := sub.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	require.Equal(t, structs.TopicNode, events.Events[0].Topic)
+}
+
+// TestEventBroker_Next_MatchesRequestNamespace asserts that a namespace-
+// scoped subscription doesn't receive events from other namespaces on the
+// same topic.
+func TestEventBroker_Next_MatchesRequestNamespace(t *testing.T) {
+	broker := NewEventBroker()
+
+	sub, err := broker.Subscribe(&SubscribeRequest{
+		Token:     "job-read-token",
+		Topics:    map[structs.Topic][]string{structs.TopicJob: {}},
+		Namespace: "default",
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	broker.Publish(structs.Events{Events: []structs.Event{
+		{Topic: structs.TopicJob, Key: "web", Namespace: "default", Index: 1},
+		{Topic: structs.TopicJob, Key: "web", Namespace: "other", Index: 2},
+	}})
+
+	events, err := sub.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	require.Equal(t, "default", events.Events[0].Namespace)
+}
+
+// TestEventBroker_Unsubscribe_DoubleCallSafe asserts that calling
+// Unsubscribe twice on the same Subscription doesn't double-release its
+// buffer reference and evict a buffer a different, still-active
+// subscriber on the same Subject is reading from.
+func TestEventBroker_Unsubscribe_DoubleCallSafe(t *testing.T) {
+	broker := NewEventBroker()
+	subject := Subject{Topic: structs.TopicJob, Key: "web"}
+
+	subA, err := broker.Subscribe(&SubscribeRequest{
+		Token:    "token-a",
+		Topics:   map[structs.Topic][]string{structs.TopicJob: {"web"}},
+		Subjects: []Subject{subject},
+	})
+	require.NoError(t, err)
+
+	subB, err := broker.Subscribe(&SubscribeRequest{
+		Token:    "token-b",
+		Topics:   map[structs.Topic][]string{structs.TopicJob: {"web"}},
+		Subjects: []Subject{subject},
+	})
+	require.NoError(t, err)
+	defer subB.Unsubscribe()
+
+	subA.Unsubscribe()
+	subA.Unsubscribe()
+
+	_, ok := broker.buffers[subject]
+	require.True(t, ok, "buffer must still exist for subB after subA is double-unsubscribed")
+
+	broker.Publish(structs.Events{Events: []structs.Event{
+		{Topic: structs.TopicJob, Key: "web", Index: 1},
+	}})
+
+	events, err := subB.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+}
+
+// TestEventBroker_BufferEvictedOnUnsubscribe asserts that a per-Subject
+// buffer is evicted once its last subscriber unsubscribes, and that
+// publishing to that Subject afterward neither recreates a leaked buffer
+// nor panics.
+func TestEventBroker_BufferEvictedOnUnsubscribe(t *testing.T) {
+	broker := NewEventBroker()
+	subject := Subject{Topic: structs.TopicJob, Key: "web"}
+
+	sub, err := broker.Subscribe(&SubscribeRequest{
+		Token:    "test-token",
+		Topics:   map[structs.Topic][]string{structs.TopicJob: {"web"}},
+		Subjects: []Subject{subject},
+	})
+	require.NoError(t, err)
+
+	_, ok := broker.buffers[subject]
+	require.True(t, ok, "buffer should exist while a subscriber is attached")
+
+	sub.Unsubscribe()
+
+	_, ok = broker.buffers[subject]
+	require.False(t, ok, "buffer should be evicted once its last subscriber unsubscribes")
+
+	// Publishing after the last subscriber leaves must not resurrect a
+	// buffer nobody is reading from.
+	broker.Publish(structs.Events{Events: []structs.Event{
+		{Topic: structs.TopicJob, Key: "web", Index: 1},
+	}})
+	_, ok = broker.buffers[subject]
+	require.False(t, ok, "publish must not recreate an unreferenced buffer")
+}
+
+// TestEventBroker_Filter asserts that Next only delivers events matching
+// the subscription's Filter expression, even though both events land in
+// the same buffer.
+func TestEventBroker_Filter(t *testing.T) {
+	broker := NewEventBroker()
+
+	sub, err := broker.Subscribe(&SubscribeRequest{
+		Token:    "test-token",
+		Topics:   map[structs.Topic][]string{structs.TopicJob: {"web"}},
+		Subjects: []Subject{{Topic: structs.TopicJob, Key: "web"}},
+		Filter:   `Namespace == "prod"`,
+	})
+	require.NoError(t, err)
+
+	broker.Publish(structs.Events{Events: []structs.Event{
+		{Topic: structs.TopicJob, Key: "web", Namespace: "staging", Index: 1},
+		{Topic: structs.TopicJob, Key: "web", Namespace: "prod", Index: 2},
+	}})
+
+	events, err := sub.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	require.Equal(t, "prod", events.Events[0].Namespace)
+}